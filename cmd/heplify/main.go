@@ -0,0 +1,14 @@
+// Command heplify runs only the --replay-pcap mode; without that flag main
+// returns at once. It does not select an interface, load a config file or
+// start a HOMER client.
+package main
+
+import "flag"
+
+func main() {
+	flag.Parse()
+
+	if runReplayPCAP() {
+		return
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"flag"
+	"log"
+
+	"github.com/sipcapture/heplify/replay"
+	"github.com/sipcapture/heplify/save"
+)
+
+// replayPCAPFile, when set, makes main re-inject an offline pcap into
+// config.Cfg.Replay's destination.
+var replayPCAPFile = flag.String("replay-pcap", "", "replay frames from this pcap file through the configured replay destination instead of capturing live")
+
+// runReplayPCAP dials a save.Replayer from config.Cfg.Replay and drives it
+// off replayPCAPFile. It returns false if replay mode was not requested;
+// otherwise it returns true once the file has been replayed, and exits the
+// process through log.Fatalf on any error.
+func runReplayPCAP() bool {
+	if *replayPCAPFile == "" {
+		return false
+	}
+
+	r, err := save.NewReplayer()
+	if err != nil {
+		log.Fatalf("replay: %v", err)
+	}
+	defer r.Close()
+
+	if err := replay.PCAP(*replayPCAPFile, r, false); err != nil {
+		log.Fatalf("replay: %v", err)
+	}
+	return true
+}
@@ -0,0 +1,82 @@
+package decoder
+
+import (
+	"bytes"
+	"net/netip"
+
+	"github.com/negbie/freecache"
+	"github.com/negbie/logp"
+)
+
+// rtcpCorrelation maps a UDP/TCP 5-tuple to the SIP Call-ID last seen on
+// that 5-tuple, populated by extractCID and consulted by
+// correlateRTCP — the value-type counterpart of isupCorrelation, keyed on
+// netip.Addr instead of formatting IPs to strings on the hot path.
+var rtcpCorrelation = freecache.NewCache(4 * 1024 * 1024) // 4 MB
+
+const rtcpCorrelationTTL = 300 // seconds
+
+// sipHeaderValue returns the trimmed value of the first header in payload
+// matching one of name (full and compact forms, e.g. "Call-ID:" and "i:").
+func sipHeaderValue(payload []byte, names ...string) []byte {
+	for _, name := range names {
+		idx := bytes.Index(payload, []byte(name))
+		if idx < 0 {
+			continue
+		}
+		start := idx + len(name)
+		end := bytes.IndexByte(payload[start:], '\r')
+		if end < 0 {
+			continue
+		}
+		return bytes.TrimSpace(payload[start : start+end])
+	}
+	return nil
+}
+
+// flowKey builds a comparison-friendly freecache key for a UDP/TCP 5-tuple
+// out of the value-type netip.Addr, so correlation never allocates a string
+// per packet.
+func flowKey(srcIP netip.Addr, srcPort uint16, dstIP netip.Addr, dstPort uint16) []byte {
+	sa, da := srcIP.As16(), dstIP.As16()
+	key := make([]byte, 0, 36)
+	key = append(key, sa[:]...)
+	key = append(key, byte(srcPort>>8), byte(srcPort))
+	key = append(key, da[:]...)
+	key = append(key, byte(dstPort>>8), byte(dstPort))
+	return key
+}
+
+// extractCID pulls the Call-ID out of a SIP message and registers it against
+// the SIP message's own 5-tuple, where correlateRTCP looks it up. The SDP
+// body is not parsed, so an RTCP report on the negotiated media address,
+// which travels on a different 5-tuple, is not joined to the dialog.
+func extractCID(srcIP netip.Addr, srcPort uint16, dstIP netip.Addr, dstPort uint16, payload []byte) {
+	cid := sipHeaderValue(payload, "Call-ID:", "i:")
+	if len(cid) == 0 {
+		return
+	}
+	if err := rtcpCorrelation.Set(flowKey(srcIP, srcPort, dstIP, dstPort), cid, rtcpCorrelationTTL); err != nil {
+		logp.Warn("%v", err)
+	}
+}
+
+// correlateRTCP looks up the Call-ID registered by extractCID for an RTCP
+// report's 5-tuple so the report rides the same HEP correlation ID as its
+// SIP dialog.
+func correlateRTCP(srcIP netip.Addr, srcPort uint16, dstIP netip.Addr, dstPort uint16, payload []byte) (out, cid []byte) {
+	v, err := rtcpCorrelation.Get(flowKey(srcIP, srcPort, dstIP, dstPort))
+	if err != nil {
+		return nil, nil
+	}
+	return payload, v
+}
+
+// correlateLOG recognizes a syslog-carried SIP message (Cfg.Mode ==
+// "SIPLOG") and reports the HEP ProtoType plus its Call-ID, if any.
+func correlateLOG(payload []byte) (proto byte, cid []byte) {
+	if bytes.Index(payload, []byte("CSeq")) < 0 && bytes.Index(payload, []byte("Cseq")) < 0 {
+		return 0, nil
+	}
+	return 1, sipHeaderValue(payload, "Call-ID:", "i:")
+}
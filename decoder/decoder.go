@@ -4,7 +4,9 @@ import (
 	"bytes"
 	"log"
 	"net"
+	"net/netip"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -32,6 +34,8 @@ type Decoder struct {
 	parser        *gopacket.DecodingLayerParser
 	parserUDP     *gopacket.DecodingLayerParser
 	parserTCP     *gopacket.DecodingLayerParser
+	parserIP4     *gopacket.DecodingLayerParser
+	parserIP6     *gopacket.DecodingLayerParser
 	sll           layers.LinuxSLL
 	d1q           layers.Dot1Q
 	gre           layers.GRE
@@ -43,13 +47,59 @@ type Decoder struct {
 	udp           layers.UDP
 	dns           layers.DNS
 	sctp          layers.SCTP
+	gtp           ownlayers.GTP
 	payload       gopacket.Payload
 	dedupCache    *freecache.Cache
 	filter        []string
-	filterSrcIP   []string
+	filterSrcIP   map[netip.Addr]struct{}
+	filterProto   []string
+	protocols     []ProtoDecoder
+	protoByUDP    map[uint16]ProtoDecoder
+	protoByTCP    map[uint16]ProtoDecoder
 	stats
 }
 
+// ProtoDecoder plugs an additional gopacket layer into the transport
+// dissection chain performed by processTransport. Factory returns a fresh
+// gopacket.DecodingLayer for every matched packet (following the custom-layer
+// pattern of ownlayers.VXLAN / ownlayers.RTP: a type embedding
+// layers.BaseLayer and implementing DecodeFromBytes/CanDecode/LayerType/
+// NextLayerType) and ToHEP turns the decoded layer into the HEP fields that
+// get forwarded under the caller supplied ProtoType.
+type ProtoDecoder struct {
+	Name     string
+	UDPPorts []uint16
+	TCPPorts []uint16
+	Factory  func() gopacket.DecodingLayer
+	ToHEP    func(layer gopacket.DecodingLayer, pkt *Packet) (protoType byte, payload []byte, cid []byte, ok bool)
+}
+
+// RegisterProtocol wires a user supplied protocol layer into the Decoder so
+// that UDP/TCP flows on udpPorts/tcpPorts are dissected with factory and
+// forwarded as HEP via toHEP. It must be called before the Decoder starts
+// processing packets. RegisterProtocol is disabled per name via
+// Cfg.DiscardProtocol, symmetric with DiscardMethod.
+func (d *Decoder) RegisterProtocol(name string, udpPorts, tcpPorts []uint16, factory func() gopacket.DecodingLayer, toHEP func(layer gopacket.DecodingLayer, pkt *Packet) (protoType byte, payload []byte, cid []byte, ok bool)) {
+	for _, v := range d.filterProto {
+		if strings.EqualFold(name, v) {
+			return
+		}
+	}
+
+	pd := ProtoDecoder{Name: name, UDPPorts: udpPorts, TCPPorts: tcpPorts, Factory: factory, ToHEP: toHEP}
+	// Store by value in the port maps: a pointer into d.protocols would dangle
+	// the moment a later RegisterProtocol call grows the slice into a new
+	// backing array.
+	d.protocols = append(d.protocols, pd)
+
+	for _, p := range udpPorts {
+		d.protoByUDP[p] = pd
+	}
+	for _, p := range tcpPorts {
+		d.protoByTCP[p] = pd
+	}
+}
+
 type stats struct {
 	_             uint32
 	fragCount     uint64
@@ -62,6 +112,9 @@ type stats struct {
 	tcpCount      uint64
 	hepCount      uint64
 	sctpCount     uint64
+	sctpChunks    uint64
+	m3uaCount     uint64
+	isupCount     uint64
 	udpCount      uint64
 	unknownCount  uint64
 }
@@ -69,8 +122,8 @@ type stats struct {
 type Packet struct {
 	Version   byte
 	Protocol  byte
-	SrcIP     net.IP
-	DstIP     net.IP
+	SrcIP     netip.Addr
+	DstIP     netip.Addr
 	SrcPort   uint16
 	DstPort   uint16
 	Tsec      uint32
@@ -81,6 +134,16 @@ type Packet struct {
 	Vlan      uint16
 }
 
+// packetPool recycles *Packet values across the hot path so processTransport
+// does not allocate on every call; callers that consume PacketQueue should
+// call Release once they are done with a Packet (e.g. after HEP encoding).
+var packetPool = sync.Pool{New: func() interface{} { return new(Packet) }}
+
+// Release returns p to packetPool so it can be reused by a later packet.
+func (p *Packet) Release() {
+	packetPool.Put(p)
+}
+
 // HEP chuncks
 const (
 	Version   = 1  // Chunk 0x0001 IP protocol family (0x02=IPv4, 0x0a=IPv6)
@@ -171,9 +234,28 @@ func NewDecoder(datalink layers.LinkType) *Decoder {
 	d.decodedLayers = make([]gopacket.LayerType, 0, 12)
 	d.parserUDP = gopacket.NewDecodingLayerParser(layers.LayerTypeUDP, &d.udp)
 	d.parserTCP = gopacket.NewDecodingLayerParser(layers.LayerTypeTCP, &d.tcp)
+	// parserIP4/parserIP6 decode a GTP-U T-PDU's inner packet on their own,
+	// reusing d.ip4/d.ip6/d.udp/d.tcp/d.sctp the same way parserUDP/parserTCP
+	// reuse d.udp/d.tcp for a re-assembled IP fragment, rather than chaining
+	// GTP into d.parser where the inner IPv4/IPv6 would overwrite the single
+	// d.ip4/d.ip6 the outer header was read from.
+	d.parserIP4 = gopacket.NewDecodingLayerParser(layers.LayerTypeIPv4, &d.ip4, &d.udp, &d.tcp, &d.sctp, &d.dns, &d.payload)
+	d.parserIP6 = gopacket.NewDecodingLayerParser(layers.LayerTypeIPv6, &d.ip6, &d.udp, &d.tcp, &d.sctp, &d.dns, &d.payload)
 
 	d.filter = strings.Split(strings.ToUpper(config.Cfg.DiscardMethod), ",")
-	d.filterSrcIP = strings.Split(config.Cfg.DiscardSrcIP, ",")
+	if config.Cfg.DiscardSrcIP != "" {
+		d.filterSrcIP = make(map[netip.Addr]struct{})
+		for _, v := range strings.Split(config.Cfg.DiscardSrcIP, ",") {
+			if addr, err := netip.ParseAddr(v); err == nil {
+				d.filterSrcIP[addr.Unmap()] = struct{}{}
+			}
+		}
+	}
+	if config.Cfg.DiscardProtocol != "" {
+		d.filterProto = strings.Split(config.Cfg.DiscardProtocol, ",")
+	}
+	d.protoByUDP = make(map[uint16]ProtoDecoder)
+	d.protoByTCP = make(map[uint16]ProtoDecoder)
 
 	if config.Cfg.Dedup {
 		d.dedupCache = freecache.NewCache(20 * 1024 * 1024) // 20 MB
@@ -341,20 +423,60 @@ func (d *Decoder) Process(data []byte, ci *gopacket.CaptureInfo) {
 	}
 }
 
+// dispatchProtocol looks up a registered protocol by port and, on a match,
+// decodes the payload with its factory layer and forwards the result as HEP
+// via its ToHEP callback. It reports whether a registered protocol consumed
+// the packet so the caller can stop further built-in dissection.
+func (d *Decoder) dispatchProtocol(byPort map[uint16]ProtoDecoder, srcPort, dstPort uint16, payload []byte, pkt *Packet) bool {
+	pd, ok := byPort[dstPort]
+	if !ok {
+		pd, ok = byPort[srcPort]
+	}
+	if !ok {
+		return false
+	}
+
+	layer := pd.Factory()
+	if err := layer.DecodeFromBytes(payload, gopacket.NilDecodeFeedback); err != nil {
+		logp.Debug("protocol", "%s: %v", pd.Name, err)
+		return false
+	}
+
+	protoType, hepPayload, cid, ok := pd.ToHEP(layer, pkt)
+	if !ok {
+		return false
+	}
+
+	pkt.ProtoType = protoType
+	pkt.Payload = hepPayload
+	pkt.CID = cid
+	PacketQueue <- pkt
+	return true
+}
+
 func (d *Decoder) processTransport(foundLayerTypes *[]gopacket.LayerType, udp *layers.UDP, tcp *layers.TCP, sctp *layers.SCTP, flow gopacket.Flow, ci *gopacket.CaptureInfo, IPVersion, IPProtocol uint8, sIP, dIP net.IP) {
-	if config.Cfg.DiscardSrcIP != "" {
-		for _, v := range d.filterSrcIP {
-			if sIP.String() == v {
-				return
-			}
+	// Convert once at the ingestion boundary so the rest of the hot path
+	// (filtering, correlation, pooling) works on a value type with no
+	// pointer to a heap-allocated byte slice.
+	srcAddr, srcOk := netip.AddrFromSlice(sIP)
+	dstAddr, dstOk := netip.AddrFromSlice(dIP)
+	if !srcOk || !dstOk {
+		return
+	}
+	srcAddr, dstAddr = srcAddr.Unmap(), dstAddr.Unmap()
+
+	if len(d.filterSrcIP) > 0 {
+		if _, found := d.filterSrcIP[srcAddr]; found {
+			return
 		}
 	}
 
-	pkt := &Packet{
+	pkt := packetPool.Get().(*Packet)
+	*pkt = Packet{
 		Version:  IPVersion,
 		Protocol: IPProtocol,
-		SrcIP:    sIP,
-		DstIP:    dIP,
+		SrcIP:    srcAddr,
+		DstIP:    dstAddr,
 		Tsec:     uint32(ci.Timestamp.Unix()),
 		Tmsec:    uint32(ci.Timestamp.Nanosecond() / 1000),
 	}
@@ -368,6 +490,7 @@ func (d *Decoder) processTransport(foundLayerTypes *[]gopacket.LayerType, udp *l
 			// log.Println("geeeeeeeeeeeeeeeet udp msg", string(udp.Payload))
 			if len(udp.Payload) < 16 {
 				logp.Warn("received too small %d byte UDP packet with payload %v", len(udp.Payload), udp.Payload)
+				pkt.Release()
 				return
 			}
 
@@ -378,11 +501,23 @@ func (d *Decoder) processTransport(foundLayerTypes *[]gopacket.LayerType, udp *l
 			// log.Println("udp pkt:  ", pkt.Version, pkt.Protocol, pkt.CID, pkt.DstIP, pkt.ProtoType)
 			logp.Debug("payload", "UDP:\n%s", pkt)
 
+			if config.Cfg.Iface.WithGTP && (isGTPPort(pkt.SrcPort) || isGTPPort(pkt.DstPort)) {
+				d.processGTP(ci, udp.Payload)
+				pkt.Release()
+				return
+			}
+
+			if d.dispatchProtocol(d.protoByUDP, pkt.SrcPort, pkt.DstPort, udp.Payload, pkt) {
+				return
+			}
+
 			if config.Cfg.Mode == "SIPLOG" {
 				if udp.DstPort == 514 {
 					pkt.ProtoType, pkt.CID = correlateLOG(udp.Payload)
 					if pkt.ProtoType > 0 && pkt.CID != nil {
 						PacketQueue <- pkt
+					} else {
+						pkt.Release()
 					}
 					return
 				}
@@ -399,6 +534,7 @@ func (d *Decoder) processTransport(foundLayerTypes *[]gopacket.LayerType, udp *l
 							return
 						}
 						atomic.AddUint64(&d.rtcpFailCount, 1)
+						pkt.Release()
 						return
 					} else if udp.SrcPort%2 == 0 && udp.DstPort%2 == 0 {
 						log.Println("rrrrrrrrrrrrrrrrrrrtp")
@@ -407,6 +543,7 @@ func (d *Decoder) processTransport(foundLayerTypes *[]gopacket.LayerType, udp *l
 							logp.Debug("rtp", "\n%v", protos.NewRTP(udp.Payload))
 						}
 						pkt.Payload = nil
+						pkt.Release()
 						return
 					}
 				}
@@ -420,6 +557,10 @@ func (d *Decoder) processTransport(foundLayerTypes *[]gopacket.LayerType, udp *l
 			atomic.AddUint64(&d.tcpCount, 1)
 			logp.Debug("payload", "TCP:\n%s", pkt)
 
+			if d.dispatchProtocol(d.protoByTCP, pkt.SrcPort, pkt.DstPort, tcp.Payload, pkt) {
+				return
+			}
+
 			if config.Cfg.Reassembly {
 				d.asm.AssembleWithTimestamp(flow, tcp, ci.Timestamp)
 				return
@@ -429,16 +570,18 @@ func (d *Decoder) processTransport(foundLayerTypes *[]gopacket.LayerType, udp *l
 		case layers.LayerTypeSCTP:
 			pkt.SrcPort = uint16(sctp.SrcPort)
 			pkt.DstPort = uint16(sctp.DstPort)
-			switch sctp.Payload[8] {
-			case 0: //DATA
-				pkt.Payload = sctp.Payload[16:]
-			case 64: //IDATA
-				pkt.Payload = sctp.Payload[20:]
-			}
 			atomic.AddUint64(&d.sctpCount, 1)
 			logp.Debug("payload", "SCTP:\n%s", pkt)
 
-			extractCID(pkt.SrcIP, pkt.SrcPort, pkt.DstIP, pkt.DstPort, pkt.Payload)
+			for _, chunk := range walkSCTPChunks(sctp.Payload) {
+				atomic.AddUint64(&d.sctpChunks, 1)
+				d.processSCTPChunk(pkt, chunk)
+			}
+			// Every chunk is forwarded, if at all, as its own clone of pkt;
+			// the base itself never carries a payload and must not fall
+			// into the generic CSeq/unknown tail below.
+			pkt.Release()
+			return
 
 		case layers.LayerTypeDNS:
 			if config.Cfg.Mode == "SIPDNS" {
@@ -467,12 +610,14 @@ func (d *Decoder) processTransport(foundLayerTypes *[]gopacket.LayerType, udp *l
 		PacketQueue <- pkt
 	} else {
 		atomic.AddUint64(&d.unknownCount, 1)
+		pkt.Release()
 	}
 }
 
 func (d *Decoder) ProcessHEPPacket(data []byte) {
 
-	pkt := &Packet{
+	pkt := packetPool.Get().(*Packet)
+	*pkt = Packet{
 		Version: 100,
 		Payload: data,
 	}
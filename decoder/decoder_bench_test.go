@@ -0,0 +1,157 @@
+package decoder
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/sipcapture/heplify/config"
+)
+
+// serializeEth builds a fully serialized Ethernet frame from the given
+// layers, mirroring the BenchmarkDecodeToDNS / benchmarkLayerDecode pattern
+// from the gopacket examples.
+func serializeEth(t testing.TB, l ...gopacket.SerializableLayer) []byte {
+	t.Helper()
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buf, opts, l...); err != nil {
+		t.Fatalf("serialize: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func ethIP4UDP(srcPort, dstPort layers.UDPPort) (*layers.Ethernet, *layers.IPv4, *layers.UDP) {
+	eth := &layers.Ethernet{
+		SrcMAC:       net.HardwareAddr{0x00, 0x01, 0x02, 0x03, 0x04, 0x05},
+		DstMAC:       net.HardwareAddr{0x00, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e},
+		EthernetType: layers.EthernetTypeIPv4,
+	}
+	ip := &layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolUDP, SrcIP: net.IPv4(10, 0, 0, 1), DstIP: net.IPv4(10, 0, 0, 2)}
+	udp := &layers.UDP{SrcPort: srcPort, DstPort: dstPort}
+	udp.SetNetworkLayerForChecksum(ip)
+	return eth, ip, udp
+}
+
+func sipUDPPacket(t testing.TB) []byte {
+	eth, ip, udp := ethIP4UDP(5060, 5060)
+	body := "INVITE sip:bob@example.com SIP/2.0\r\nCSeq: 1 INVITE\r\n\r\n"
+	return serializeEth(t, eth, ip, udp, gopacket.Payload(body))
+}
+
+func sipTCPPacket(t testing.TB) []byte {
+	eth, ip, _ := ethIP4UDP(0, 0)
+	ip.Protocol = layers.IPProtocolTCP
+	tcp := &layers.TCP{SrcPort: 5060, DstPort: 5060, Seq: 1, ACK: true, PSH: true}
+	tcp.SetNetworkLayerForChecksum(ip)
+	body := "INVITE sip:bob@example.com SIP/2.0\r\nCSeq: 1 INVITE\r\n\r\n"
+	return serializeEth(t, eth, ip, tcp, gopacket.Payload(body))
+}
+
+func rtcpPacket(t testing.TB) []byte {
+	// Odd ports on both ends and a 28 byte sender report: processTransport
+	// drops UDP payloads under 16 bytes and only treats odd/odd flows as RTCP.
+	eth, ip, udp := ethIP4UDP(20001, 20003)
+	rtcp := append([]byte{0x80, 200, 0x00, 0x06}, make([]byte, 24)...)
+	return serializeEth(t, eth, ip, udp, gopacket.Payload(rtcp))
+}
+
+func sctpM3UAPacket(t testing.TB) []byte {
+	eth, ip, _ := ethIP4UDP(0, 0)
+	ip.Protocol = layers.IPProtocolSCTP
+	sctp := &layers.SCTP{SrcPort: 2905, DstPort: 2905}
+	sctp.SetNetworkLayerForChecksum(ip)
+
+	isup := []byte{0x01, 0x00, 0x01} // CIC=1, message type=IAM
+	// OPC, DPC, then SI/NI/MP/SLS ahead of the ISUP user data.
+	protoData := append([]byte{0, 0, 0, 1, 0, 0, 0, 2, 5, 0, 0, 0}, isup...)
+	for len(protoData)%4 != 0 {
+		protoData = append(protoData, 0)
+	}
+	param := append([]byte{0x02, 0x10, byte((len(protoData) + 4) >> 8), byte(len(protoData) + 4)}, protoData...)
+	m3ua := append([]byte{1, 0, 1, 1, 0, 0, 0, byte(len(param) + 8)}, param...)
+
+	// DATA chunk header: type, flags, length, TSN, stream id/seq, PPID.
+	chunk := append([]byte{0, 0, byte((len(m3ua) + 16) >> 8), byte(len(m3ua) + 16)}, make([]byte, 8)...)
+	chunk = append(chunk, 0, 0, 0, sctpPPIDM3UA)
+	chunk = append(chunk, m3ua...)
+	return serializeEth(t, eth, ip, sctp, gopacket.Payload(chunk))
+}
+
+func ip4FragPacket(t testing.TB) []byte {
+	eth, ip, _ := ethIP4UDP(0, 0)
+	ip.Flags = layers.IPv4MoreFragments
+	ip.FragOffset = 0
+	ip.Protocol = layers.IPProtocolUDP
+	return serializeEth(t, eth, ip, gopacket.Payload(make([]byte, 64)))
+}
+
+func vxlanSIPPacket(t testing.TB) []byte {
+	eth, ip, udp := ethIP4UDP(0, 4789)
+	vx := &layers.VXLAN{VNI: 42}
+	innerEth := &layers.Ethernet{SrcMAC: eth.SrcMAC, DstMAC: eth.DstMAC, EthernetType: layers.EthernetTypeIPv4}
+	innerEth2, innerIP, innerUDP := ethIP4UDP(5060, 5060)
+	_ = innerEth
+	body := "INVITE sip:bob@example.com SIP/2.0\r\nCSeq: 1 INVITE\r\n\r\n"
+	return serializeEth(t, eth, ip, udp, vx, innerEth2, innerIP, innerUDP, gopacket.Payload(body))
+}
+
+func erspanPacket(t testing.TB) []byte {
+	eth, ip, _ := ethIP4UDP(0, 0)
+	ip.Protocol = layers.IPProtocolGRE
+	gre := &layers.GRE{Protocol: 0x88be}
+	erspan := gopacket.Payload{0x10, 0, 0, 0, 0, 0, 0, 0} // 8 byte ERSPAN version 1 header
+	innerEth, innerIP, innerUDP := ethIP4UDP(5060, 5060)
+	body := "INVITE sip:bob@example.com SIP/2.0\r\nCSeq: 1 INVITE\r\n\r\n"
+	return serializeEth(t, eth, ip, gre, erspan, innerEth, innerIP, innerUDP, gopacket.Payload(body))
+}
+
+// benchmarkDecode mirrors benchmarkLayerDecode from the gopacket examples: it
+// resets allocation counters right before the timed loop so setup cost isn't
+// attributed to Decoder.Process. A draining goroutine keeps PacketQueue
+// (capacity 20000) from filling up and blocking Process on b.N > 20000 —
+// every decoded Packet is released back to packetPool once drained.
+func benchmarkDecode(b *testing.B, build func(testing.TB) []byte) {
+	d := NewDecoder(layers.LinkTypeEthernet)
+	data := build(b)
+	ci := &gopacket.CaptureInfo{Timestamp: time.Now(), CaptureLength: len(data), Length: len(data)}
+
+	stop := make(chan struct{})
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		for {
+			select {
+			case pkt := <-PacketQueue:
+				pkt.Release()
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		d.Process(data, ci)
+	}
+	b.StopTimer()
+
+	close(stop)
+	<-drained
+}
+
+func BenchmarkDecodeSIPUDP(b *testing.B)   { benchmarkDecode(b, sipUDPPacket) }
+func BenchmarkDecodeSIPTCP(b *testing.B)   { benchmarkDecode(b, sipTCPPacket) }
+func BenchmarkDecodeRTCP(b *testing.B)     { benchmarkDecode(b, rtcpPacket) }
+func BenchmarkDecodeSCTPM3UA(b *testing.B) { benchmarkDecode(b, sctpM3UAPacket) }
+func BenchmarkDecodeIP4Frag(b *testing.B)  { benchmarkDecode(b, ip4FragPacket) }
+func BenchmarkDecodeVXLANSIP(b *testing.B) { benchmarkDecode(b, vxlanSIPPacket) }
+func BenchmarkDecodeERSPAN(b *testing.B) {
+	old := config.Cfg.Iface.WithErspan
+	config.Cfg.Iface.WithErspan = true
+	defer func() { config.Cfg.Iface.WithErspan = old }()
+	benchmarkDecode(b, erspanPacket)
+}
@@ -0,0 +1,80 @@
+package decoder
+
+import (
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/negbie/logp"
+)
+
+// GTP-U/GTP-C well known ports, see 3GPP TS 29.281/29.060.
+const (
+	gtpUPort = 2152
+	gtpCPort = 2123
+)
+
+// isGTPPort reports whether port carries GTP-U or GTP-C traffic.
+func isGTPPort(port uint16) bool {
+	return port == gtpUPort || port == gtpCPort
+}
+
+// processGTP decodes a GTP header out of a UDP payload already matched to
+// gtpUPort/gtpCPort and, for a GTP-U T-PDU, re-enters the IPv4/IPv6 decoding
+// chain on its inner packet via parserIP4/parserIP6 — the same re-entry
+// Process performs on a GRE/ERSPAN payload via d.parser. GTP is deliberately
+// kept out of d.parser's chain: the inner IPv4/IPv6 of a T-PDU would decode
+// straight into the single d.ip4/d.ip6 used for the outer header, so by the
+// time Process's loop reached either occurrence of LayerTypeIPv4 in
+// d.decodedLayers it would read the inner values twice and the outer header
+// would be lost.
+func (d *Decoder) processGTP(ci *gopacket.CaptureInfo, payload []byte) {
+	if err := d.gtp.DecodeFromBytes(payload, gopacket.NilDecodeFeedback); err != nil {
+		logp.Debug("gtp", "%v", err)
+		return
+	}
+
+	next := d.gtp.NextLayerType()
+	if next == gopacket.LayerTypeZero {
+		// GTP-C signalling (create/modify/delete session, echo, ...) carries
+		// no inner IP packet to re-enter decoding on; forward it the same way
+		// an unrecognized SCTP PPID falls through to generic CSeq/CID
+		// extraction in processSCTPChunk rather than being silently dropped.
+		proto, cid := correlateLOG(d.gtp.Payload)
+		if proto == 0 {
+			return
+		}
+
+		pkt := packetPool.Get().(*Packet)
+		*pkt = Packet{
+			ProtoType: proto,
+			Payload:   d.gtp.Payload,
+			CID:       cid,
+			Tsec:      uint32(ci.Timestamp.Unix()),
+			Tmsec:     uint32(ci.Timestamp.Nanosecond() / 1000),
+		}
+		PacketQueue <- pkt
+		return
+	}
+
+	var decoded []gopacket.LayerType
+	var err error
+	if next == layers.LayerTypeIPv6 {
+		err = d.parserIP6.DecodeLayers(d.gtp.Payload, &decoded)
+	} else {
+		err = d.parserIP4.DecodeLayers(d.gtp.Payload, &decoded)
+	}
+	if err != nil {
+		// As in Process, an error for a layer the parser does not hold (e.g.
+		// gopacket's SIP layer on port 5060) still leaves the IP and
+		// transport layers in decoded, so they are processed below.
+		logp.Debug("gtp", "inner packet: %v", err)
+	}
+
+	for _, lt := range decoded {
+		switch lt {
+		case layers.LayerTypeIPv4:
+			d.processTransport(&decoded, &d.udp, &d.tcp, &d.sctp, d.ip4.NetworkFlow(), ci, 0x02, uint8(d.ip4.Protocol), d.ip4.SrcIP, d.ip4.DstIP)
+		case layers.LayerTypeIPv6:
+			d.processTransport(&decoded, &d.udp, &d.tcp, &d.sctp, d.ip6.NetworkFlow(), ci, 0x0a, uint8(d.ip6.NextHeader), d.ip6.SrcIP, d.ip6.DstIP)
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package decoder
+
+import "net/netip"
+
+// ipChunk reports the HEP chunk ID that should carry addr (v4 or v6) and
+// addr's string form. This is the only point where a netip.Addr becomes a
+// string — Packet.SrcIP/DstIP stay a value type through the whole hot path
+// and only get formatted here, at the HEP serialization boundary.
+func ipChunk(addr netip.Addr, v4, v6 uint8) (chunkType uint8, s string) {
+	if addr.Is4() || addr.Is4In6() {
+		return v4, addr.Unmap().String()
+	}
+	return v6, addr.String()
+}
+
+// EncodeIPChunks returns the HEP chunk IDs and string representations for a
+// Packet's SrcIP/DstIP, selecting IP4SrcIP/IP4DstIP or IP6SrcIP/IP6DstIP
+// depending on the address family.
+func (p *Packet) EncodeIPChunks() (srcChunk uint8, srcIP string, dstChunk uint8, dstIP string) {
+	srcChunk, srcIP = ipChunk(p.SrcIP, IP4SrcIP, IP6SrcIP)
+	dstChunk, dstIP = ipChunk(p.DstIP, IP4DstIP, IP6DstIP)
+	return
+}
@@ -0,0 +1,234 @@
+package decoder
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sync/atomic"
+
+	"github.com/negbie/freecache"
+	"github.com/negbie/logp"
+)
+
+// SCTP chunk types we care about, see RFC 4960 3.2.
+const (
+	sctpChunkData  = 0
+	sctpChunkIData = 64
+)
+
+// SCTP payload protocol identifiers, see RFC 4960 14.4.
+const (
+	sctpPPIDM3UA = 3
+	sctpPPIDM2PA = 5
+)
+
+// protoTypeISUP is the HEP ProtoType chunk 0x000b value an ISUP leg is
+// forwarded under. It is distinct from SIP's ProtoType 1 because, unlike
+// RTCP/extractCID correlation, an ISUP leg is forwarded even when no SIP-I
+// Call-ID has been registered for its circuit yet.
+const protoTypeISUP = 55
+
+// sctpChunk is a single walked SCTP chunk carrying a DATA/IDATA user payload
+// together with the PPID it was announced under.
+type sctpChunk struct {
+	PPID    uint32
+	Payload []byte
+}
+
+// walkSCTPChunks iterates every chunk header (type, flags, length) in an
+// SCTP packet payload, padding each chunk to the 4 byte boundary required by
+// RFC 4960 6.1, and returns the DATA/IDATA user payloads it finds. Unlike a
+// fixed-offset slice this does not stop at the first chunk, so bundled SCTP
+// packets are fully accounted for.
+func walkSCTPChunks(data []byte) []sctpChunk {
+	var chunks []sctpChunk
+
+	for len(data) >= 4 {
+		cType := data[0]
+		length := int(binary.BigEndian.Uint16(data[2:4]))
+		if length < 4 || length > len(data) {
+			break
+		}
+
+		switch cType {
+		case sctpChunkData:
+			if length >= 16 {
+				chunks = append(chunks, sctpChunk{
+					PPID:    binary.BigEndian.Uint32(data[12:16]),
+					Payload: data[16:length],
+				})
+			}
+		case sctpChunkIData:
+			if length >= 20 {
+				chunks = append(chunks, sctpChunk{
+					PPID:    binary.BigEndian.Uint32(data[16:20]),
+					Payload: data[20:length],
+				})
+			}
+		}
+
+		padded := length + (4-length%4)%4
+		if padded > len(data) {
+			break
+		}
+		data = data[padded:]
+	}
+
+	return chunks
+}
+
+// processSCTPChunk dispatches a single DATA/IDATA user payload by PPID,
+// cloning base into a fresh *Packet for every message it forwards so that
+// bundled chunks never race each other on the shared Packet instance built
+// in processTransport.
+func (d *Decoder) processSCTPChunk(base *Packet, chunk sctpChunk) {
+	switch chunk.PPID {
+	case sctpPPIDM3UA:
+		opc, dpc, payload, ok := parseM3UA(chunk.Payload)
+		if !ok {
+			return
+		}
+		atomic.AddUint64(&d.m3uaCount, 1)
+
+		proto, cid := correlateISUP(opc, dpc, payload)
+		if proto == 0 {
+			return
+		}
+		atomic.AddUint64(&d.isupCount, 1)
+
+		pkt := base.clone()
+		pkt.ProtoType = proto
+		pkt.Payload = payload
+		pkt.CID = cid
+		PacketQueue <- pkt
+
+	case sctpPPIDM2PA:
+		// M2PA carries MTP3 directly; fall through to the generic CSeq/CID
+		// extraction performed for unknown PPIDs below.
+		fallthrough
+
+	default:
+		pkt := base.clone()
+		pkt.Payload = chunk.Payload
+		extractCID(pkt.SrcIP, pkt.SrcPort, pkt.DstIP, pkt.DstPort, pkt.Payload)
+
+		// Mirror the CSeq/ProtoType detection at the bottom of
+		// processTransport so an unknown PPID carrying SIP (the baseline
+		// behaviour before SCTP chunk walking existed) is still forwarded,
+		// and so the clone is always either enqueued or released.
+		var cPos int
+		if cPos = bytes.Index(pkt.Payload, []byte("CSeq")); cPos > -1 {
+			pkt.ProtoType = 1
+		} else if cPos = bytes.Index(pkt.Payload, []byte("Cseq")); cPos > -1 {
+			pkt.ProtoType = 1
+		}
+		if cPos > 16 {
+			if s := bytes.Index(pkt.Payload[:cPos], []byte("Sip0")); s > -1 {
+				pkt.Payload = pkt.Payload[s+4:]
+			}
+		}
+
+		if pkt.ProtoType > 0 && pkt.Payload != nil {
+			PacketQueue <- pkt
+		} else {
+			atomic.AddUint64(&d.unknownCount, 1)
+			pkt.Release()
+		}
+	}
+}
+
+// clone returns a pooled shallow copy of p so concurrent consumers of
+// PacketQueue never observe another message's Payload/ProtoType/CID
+// overwriting this one.
+func (p *Packet) clone() *Packet {
+	c := packetPool.Get().(*Packet)
+	*c = *p
+	return c
+}
+
+// M3UA message class/type we dissect, see RFC 4666 3.1/3.3.1.
+const (
+	m3uaClassTransfer = 1
+	m3uaTypeData      = 1
+	m3uaTagProtoData  = 0x0210
+)
+
+// parseM3UA extracts the OPC, DPC and inner MTP3/ISUP payload carried in an
+// M3UA Transfer Message's Protocol Data parameter.
+func parseM3UA(data []byte) (opc, dpc uint32, payload []byte, ok bool) {
+	if len(data) < 8 {
+		return 0, 0, nil, false
+	}
+	if data[2] != m3uaClassTransfer || data[3] != m3uaTypeData {
+		return 0, 0, nil, false
+	}
+
+	params := data[8:]
+	for len(params) >= 4 {
+		tag := binary.BigEndian.Uint16(params[0:2])
+		length := int(binary.BigEndian.Uint16(params[2:4]))
+		if length < 4 || length > len(params) {
+			break
+		}
+
+		if tag == m3uaTagProtoData && length >= 16 {
+			opc = binary.BigEndian.Uint32(params[4:8])
+			dpc = binary.BigEndian.Uint32(params[8:12])
+			return opc, dpc, params[16:length], true
+		}
+
+		padded := length + (4-length%4)%4
+		if padded > len(params) {
+			break
+		}
+		params = params[padded:]
+	}
+
+	logp.Debug("m3ua", "no Protocol Data parameter in Transfer Message")
+	return 0, 0, nil, false
+}
+
+// isupCorrelation maps an ISUP circuit (OPC+DPC+CIC) to the SIP Call-ID of
+// the dialog it belongs to, the same way correlateRTCP/extractCID bridge an
+// RTCP 5-tuple to SIP.
+var isupCorrelation = freecache.NewCache(4 * 1024 * 1024) // 4 MB
+
+// isupCorrelationTTL is generous relative to a call setup/teardown so a CIC
+// registered off a SIP-I INVITE still resolves once the matching ISUP
+// REL/ANM arrives over SIGTRAN.
+const isupCorrelationTTL = 300 // seconds
+
+// RegisterISUPCID associates an ISUP circuit with the Call-ID of the SIP-I
+// dialog that carries it, so correlateISUP can join the SIGTRAN leg to the
+// same HEP correlation ID. Nothing in this tree calls it: no SIP-I body is
+// parsed for a CIC, so correlateISUP returns a nil cid unless some other
+// caller has registered the circuit.
+func RegisterISUPCID(opc, dpc uint32, cic uint16, cid []byte) {
+	if err := isupCorrelation.Set(isupKey(opc, dpc, cic), cid, isupCorrelationTTL); err != nil {
+		logp.Warn("%v", err)
+	}
+}
+
+// correlateISUP extracts the Circuit Identification Code from an ISUP
+// message (ITU-T Q.763 1.1 — a 12 bit CIC in the first two, little-endian
+// octets) and looks up the SIP Call-ID registered for OPC+DPC+CIC. The ISUP
+// leg is always forwarded under protoTypeISUP, with cid set when a SIP-I
+// dialog has already registered this circuit and nil otherwise — nothing
+// calls RegisterISUPCID yet, and dropping every ISUP message until something
+// does would mean the SIGTRAN path never emits HEP at all.
+func correlateISUP(opc, dpc uint32, payload []byte) (proto byte, cid []byte) {
+	if len(payload) < 2 {
+		return 0, nil
+	}
+	cic := binary.LittleEndian.Uint16(payload[0:2]) & 0x0fff
+
+	cid, _ = isupCorrelation.Get(isupKey(opc, dpc, cic))
+	return protoTypeISUP, cid
+}
+
+func isupKey(opc, dpc uint32, cic uint16) []byte {
+	key := make([]byte, 10)
+	binary.BigEndian.PutUint32(key[0:4], opc)
+	binary.BigEndian.PutUint32(key[4:8], dpc)
+	binary.BigEndian.PutUint16(key[8:10], cic)
+	return key
+}
@@ -0,0 +1,36 @@
+package decoder
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/negbie/logp"
+)
+
+// printStats logs the decoder's packet/protocol counters every interval so
+// operators can see decode and correlation throughput without instrumenting
+// PacketQueue consumers separately.
+func (d *Decoder) printStats(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		logp.Info("decoder stats: dup=%d frag=%d dns=%d ip4=%d ip6=%d tcp=%d udp=%d sctp=%d sctpChunks=%d m3ua=%d isup=%d rtcp=%d rtcpFail=%d hep=%d unknown=%d",
+			atomic.LoadUint64(&d.dupCount),
+			atomic.LoadUint64(&d.fragCount),
+			atomic.LoadUint64(&d.dnsCount),
+			atomic.LoadUint64(&d.ip4Count),
+			atomic.LoadUint64(&d.ip6Count),
+			atomic.LoadUint64(&d.tcpCount),
+			atomic.LoadUint64(&d.udpCount),
+			atomic.LoadUint64(&d.sctpCount),
+			atomic.LoadUint64(&d.sctpChunks),
+			atomic.LoadUint64(&d.m3uaCount),
+			atomic.LoadUint64(&d.isupCount),
+			atomic.LoadUint64(&d.rtcpCount),
+			atomic.LoadUint64(&d.rtcpFailCount),
+			atomic.LoadUint64(&d.hepCount),
+			atomic.LoadUint64(&d.unknownCount),
+		)
+	}
+}
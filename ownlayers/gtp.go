@@ -0,0 +1,115 @@
+package ownlayers
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// gtpMessageTypeTPDU is the GTP-U message type carrying a user IP packet
+// (3GPP TS 29.281 5.1), the only message type this layer decodes further.
+const gtpMessageTypeTPDU = 255
+
+// LayerTypeGTP is registered for GTPv1 (3GPP TS 29.060/29.281), used to
+// carry SIP/IMS and Diameter traffic over Gn/S5/S8/N3 interfaces in mobile
+// cores.
+var LayerTypeGTP = gopacket.RegisterLayerType(
+	3001,
+	gopacket.LayerTypeMetadata{Name: "GTP", Decoder: gopacket.DecodeFunc(decodeGTP)},
+)
+
+// GTP is a GTPv1-U/C header: an 8 byte mandatory part followed by an
+// optional 4 byte part (sequence number, N-PDU number, next extension
+// header type) and zero or more chained extension headers.
+type GTP struct {
+	layers.BaseLayer
+	Version                 uint8
+	ProtocolType            uint8
+	HasExtensionHeader      bool
+	HasSequenceNumber       bool
+	HasNPDUNumber           bool
+	MessageType             uint8
+	Length                  uint16
+	TEID                    uint32
+	SequenceNumber          uint16
+	NPDUNumber              uint8
+	NextExtensionHeaderType uint8
+}
+
+// DecodeFromBytes parses the GTPv1 header out of data, following the GTP-U
+// T-PDU extension header chain (3GPP TS 29.060 6.1) so Payload starts at the
+// inner packet regardless of which optional fields are present.
+func (g *GTP) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	if len(data) < 8 {
+		return errors.New("GTP packet too small")
+	}
+
+	flags := data[0]
+	g.Version = flags >> 5
+	g.ProtocolType = (flags >> 4) & 0x1
+	g.HasExtensionHeader = flags&0x04 != 0
+	g.HasSequenceNumber = flags&0x02 != 0
+	g.HasNPDUNumber = flags&0x01 != 0
+	g.MessageType = data[1]
+	g.Length = binary.BigEndian.Uint16(data[2:4])
+	g.TEID = binary.BigEndian.Uint32(data[4:8])
+
+	hdrLen := 8
+	if g.HasExtensionHeader || g.HasSequenceNumber || g.HasNPDUNumber {
+		if len(data) < 12 {
+			return errors.New("GTP optional header truncated")
+		}
+		g.SequenceNumber = binary.BigEndian.Uint16(data[8:10])
+		g.NPDUNumber = data[10]
+		g.NextExtensionHeaderType = data[11]
+		hdrLen = 12
+
+		for g.NextExtensionHeaderType != 0 {
+			if len(data) < hdrLen+1 {
+				return errors.New("GTP extension header truncated")
+			}
+			extLen := int(data[hdrLen]) * 4
+			if extLen < 4 || len(data) < hdrLen+extLen {
+				return errors.New("GTP extension header truncated")
+			}
+			g.NextExtensionHeaderType = data[hdrLen+extLen-1]
+			hdrLen += extLen
+		}
+	}
+
+	if len(data) < hdrLen {
+		return errors.New("GTP header truncated")
+	}
+	g.BaseLayer = layers.BaseLayer{Contents: data[:hdrLen], Payload: data[hdrLen:]}
+	return nil
+}
+
+// CanDecode, LayerType, NextLayerType and DecodeFromBytes make GTP usable
+// both as a gopacket.DecodingLayer (for gopacket.DecodingLayerParser) and,
+// via decodeGTP, as a regular gopacket layer.
+func (g *GTP) CanDecode() gopacket.LayerClass { return LayerTypeGTP }
+func (g *GTP) LayerType() gopacket.LayerType  { return LayerTypeGTP }
+
+// NextLayerType reports the inner IP layer carried by a GTP-U T-PDU; every
+// other GTP message (GTP-C signalling, echo request/response, ...) has
+// nothing further for gopacket to decode.
+func (g *GTP) NextLayerType() gopacket.LayerType {
+	if g.MessageType != gtpMessageTypeTPDU || len(g.Payload) == 0 {
+		return gopacket.LayerTypeZero
+	}
+	if g.Payload[0]>>4 == 6 {
+		return layers.LayerTypeIPv6
+	}
+	return layers.LayerTypeIPv4
+}
+
+func decodeGTP(data []byte, p gopacket.PacketBuilder) error {
+	g := &GTP{}
+	if err := g.DecodeFromBytes(data, p); err != nil {
+		return err
+	}
+	p.AddLayer(g)
+	return p.NextDecoder(g.NextLayerType())
+}
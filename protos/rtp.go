@@ -4,10 +4,15 @@ import (
 	"log"
 
 	"github.com/google/gopacket"
+	"github.com/sipcapture/heplify/config"
 	"github.com/sipcapture/heplify/ownlayers"
 	"github.com/sipcapture/heplify/save"
 )
 
+// replayer is lazily dialed the first time a packet needs replaying so that
+// leaving config.Cfg.Replay unset costs nothing.
+var replayer *save.Replayer
+
 func NewRTP(raw []byte) string {
 	rtpl := gopacket.NewPacket(raw, ownlayers.LayerTypeRTP, gopacket.DecodeOptions{Lazy: true, NoCopy: true})
 	rtp, ok := rtpl.Layers()[0].(*ownlayers.RTP)
@@ -16,9 +21,15 @@ func NewRTP(raw []byte) string {
 		return "this is not a RTP packet!"
 	}
 	log.Println("rtp payload type", rtp.PayloadType)
-	if rtp.PayloadType == 99 {
-		save.SendRTP(raw)
-
+	if replayer == nil && config.Cfg.Replay.Host != "" {
+		var err error
+		replayer, err = save.NewReplayer()
+		if err != nil {
+			log.Printf("replay disabled: %v", err)
+		}
+	}
+	if replayer != nil && replayer.Match("", rtp.SSRC, rtp.PayloadType) {
+		replayer.Send(raw)
 	}
 	return rtp.String()
 }
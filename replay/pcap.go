@@ -0,0 +1,65 @@
+// Package replay drives a decoder.Decoder over an offline pcap file and
+// feeds the matched packets into a save.Replayer. It lives outside the
+// decoder package (which save must not import, to avoid the
+// decoder -> protos -> save -> decoder cycle) so it is the only package that
+// ever links decoder and save together for pcap replay.
+package replay
+
+import (
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcap"
+	"github.com/negbie/logp"
+	"github.com/sipcapture/heplify/decoder"
+	"github.com/sipcapture/heplify/save"
+)
+
+// PCAP opens file with gopacket/pcap, runs every frame through a fresh
+// Decoder sized for the file's link type, and serializes matched packets onto
+// r as Ethernet/IPv4/UDP frames with all-zero MACs and the packet's original
+// src/dst IPs and ports; addressing is not rewritten. It backs the binary's --replay-pcap flag so
+// operators can load-test a HOMER setup or re-inject a production capture
+// into a lab.
+func PCAP(file string, r *save.Replayer, loop bool) error {
+	handle, err := pcap.OpenOffline(file)
+	if err != nil {
+		return err
+	}
+	defer handle.Close()
+
+	dec := decoder.NewDecoder(handle.LinkType())
+
+	go func() {
+		for pkt := range decoder.PacketQueue {
+			if !r.MatchCID(string(pkt.CID)) {
+				pkt.Release()
+				continue
+			}
+
+			// layers.Ethernet refuses to serialize a MAC that is not 6 bytes.
+			frame, err := save.SerializeUDP(make([]byte, 6), make([]byte, 6), pkt.SrcIP.AsSlice(), pkt.DstIP.AsSlice(), layers.UDPPort(pkt.SrcPort), layers.UDPPort(pkt.DstPort), pkt.Payload)
+			pkt.Release()
+			if err != nil {
+				logp.Warn("replay serialize: %v", err)
+				continue
+			}
+			r.Send(frame)
+		}
+	}()
+
+	src := gopacket.NewPacketSource(handle, handle.LinkType())
+	for {
+		data, ci, err := src.ReadPacketData()
+		if err == pcap.NextErrorNoMoreBlocks {
+			if loop {
+				src = gopacket.NewPacketSource(handle, handle.LinkType())
+				continue
+			}
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		dec.Process(data, &ci)
+	}
+}
@@ -0,0 +1,124 @@
+package save
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/negbie/logp"
+	"github.com/sipcapture/heplify/config"
+)
+
+// Replayer re-injects captured SIP/RTP/HEP payloads into a configured
+// destination over a single reusable connection. It supersedes the old
+// SendRTP helper, which hardcoded 192.168.2.78:1234 and dialed a brand new
+// UDP socket for every packet.
+type Replayer struct {
+	conn  net.Conn
+	queue chan []byte
+	rate  time.Duration
+	loop  bool
+	cfg   config.ReplayConfig
+	wg    sync.WaitGroup
+}
+
+// NewReplayer dials config.Cfg.Replay's destination once and starts the
+// worker goroutine that drains the replay queue onto it.
+func NewReplayer() (*Replayer, error) {
+	rc := config.Cfg.Replay
+
+	conn, err := net.Dial(rc.Transport, net.JoinHostPort(rc.Host, rc.Port))
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Replayer{
+		conn:  conn,
+		queue: make(chan []byte, 1000),
+		loop:  rc.Loop,
+		cfg:   rc,
+	}
+	if rc.Rate > 0 {
+		r.rate = time.Second / time.Duration(rc.Rate)
+	}
+
+	r.wg.Add(1)
+	go r.run()
+	return r, nil
+}
+
+// Send enqueues data for replay. It drops the packet rather than blocking
+// the capture hot path when the queue is full.
+func (r *Replayer) Send(data []byte) {
+	select {
+	case r.queue <- data:
+	default:
+		logp.Warn("replay queue full, dropping %d byte packet", len(data))
+	}
+}
+
+// Match reports whether an RTP packet should be replayed given the
+// configured Call-ID/SSRC/payload-type filter. An unset filter field matches
+// anything.
+func (r *Replayer) Match(callID string, ssrc uint32, payloadType byte) bool {
+	if r.cfg.FilterCallID != "" && r.cfg.FilterCallID != callID {
+		return false
+	}
+	if r.cfg.FilterSSRC != 0 && r.cfg.FilterSSRC != ssrc {
+		return false
+	}
+	if r.cfg.FilterPT != 0 && r.cfg.FilterPT != payloadType {
+		return false
+	}
+	return true
+}
+
+// MatchCID reports whether a non-RTP packet (SIP, ISUP, ...) should be
+// replayed given the configured Call-ID filter. It ignores FilterSSRC/FilterPT
+// since those packets carry no RTP identifiers to match against.
+func (r *Replayer) MatchCID(callID string) bool {
+	return r.cfg.FilterCallID == "" || r.cfg.FilterCallID == callID
+}
+
+func (r *Replayer) run() {
+	defer r.wg.Done()
+	for data := range r.queue {
+		if _, err := r.conn.Write(data); err != nil {
+			logp.Warn("replay write: %v", err)
+			continue
+		}
+		if r.rate > 0 {
+			time.Sleep(r.rate)
+		}
+	}
+}
+
+// Close drains the queue and closes the underlying connection.
+func (r *Replayer) Close() error {
+	close(r.queue)
+	r.wg.Wait()
+	return r.conn.Close()
+}
+
+// SerializeUDP rebuilds data as an Ethernet/IPv4/UDP frame carrying the given
+// MAC, IP and port addressing, following the gopacket serialization example,
+// so a caller can rewrite src/dst addressing on the way out. It is
+// exported for the replay package, which drives the pcap replay loop and
+// must stay free of a decoder import (see replay.PCAP).
+func SerializeUDP(srcMAC, dstMAC net.HardwareAddr, srcIP, dstIP net.IP, srcPort, dstPort layers.UDPPort, data []byte) ([]byte, error) {
+	eth := layers.Ethernet{SrcMAC: srcMAC, DstMAC: dstMAC, EthernetType: layers.EthernetTypeIPv4}
+	ip := layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolUDP, SrcIP: srcIP, DstIP: dstIP}
+	udp := layers.UDP{SrcPort: srcPort, DstPort: dstPort}
+	if err := udp.SetNetworkLayerForChecksum(&ip); err != nil {
+		return nil, err
+	}
+
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buf, opts, &eth, &ip, &udp, gopacket.Payload(data)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}